@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// tileRecord is the per-tile record shape shared by the json/ndjson/csv
+// output modes.
+type tileRecord struct {
+	Z        int           `json:"z"`
+	X        int           `json:"x"`
+	Y        int           `json:"y"`
+	Size     uint64        `json:"size"`
+	Gzipped  uint64        `json:"gzipped_size"`
+	Features uint64        `json:"features"`
+	Layers   []layerRecord `json:"layers"`
+}
+
+type layerRecord struct {
+	Name        string            `json:"name"`
+	Count       uint64            `json:"count"`
+	GeomTypes   map[string]uint64 `json:"geom_types"`
+	AvgVertices float64           `json:"avg_vertices"`
+}
+
+func newTileRecord(info tileInfo) tileRecord {
+	rec := tileRecord{
+		Z:        info.Z,
+		X:        info.X,
+		Y:        info.Y,
+		Size:     info.Size,
+		Gzipped:  info.GzippedSize,
+		Features: info.Features,
+	}
+	for _, l := range info.Layers {
+		lr := layerRecord{Name: l.Name, Count: l.Count, GeomTypes: l.GeomTypes}
+		if l.Count > 0 {
+			lr.AvgVertices = float64(l.TotalVertices) / float64(l.Count)
+		}
+		rec.Layers = append(rec.Layers, lr)
+	}
+	return rec
+}
+
+// reporter consumes tileInfo values as they arrive on the scan channel and
+// renders them in one output format.
+type reporter interface {
+	handle(info tileInfo)
+	finish()
+}
+
+func newReporter(format string) (reporter, error) {
+	switch format {
+	case "", "text":
+		return &textReporter{byZoom: make(map[int]*zoomStats)}, nil
+	case "json":
+		return &jsonReporter{byZoom: make(map[int]*zoomStats)}, nil
+	case "ndjson":
+		return &ndjsonReporter{enc: json.NewEncoder(os.Stdout)}, nil
+	case "csv":
+		r := &csvReporter{w: csv.NewWriter(os.Stdout)}
+		r.w.Write([]string{"z", "x", "y", "size", "gzipped_size", "features", "layer", "layer_count", "avg_vertices"})
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unknown -format %q (want text, json, csv or ndjson)", format)
+	}
+}
+
+type textReporter struct {
+	byZoom map[int]*zoomStats
+}
+
+func (r *textReporter) handle(info tileInfo) {
+	s, ok := r.byZoom[info.Z]
+	if !ok {
+		s = newZoomStats(info.Z)
+		r.byZoom[info.Z] = s
+	}
+	s.record(info)
+}
+
+func (r *textReporter) finish() {
+	printReport(r.byZoom)
+}
+
+// zoomSummaryDoc is the JSON-friendly rendering of a zoomStats.
+type zoomSummaryDoc struct {
+	Zoom        int               `json:"zoom"`
+	TileCount   int               `json:"tile_count"`
+	MinSize     uint64            `json:"min_size"`
+	MaxSize     uint64            `json:"max_size"`
+	AvgSize     float64           `json:"avg_size"`
+	MinFeatures uint64            `json:"min_features"`
+	MaxFeatures uint64            `json:"max_features"`
+	AvgFeatures float64           `json:"avg_features"`
+	Layers      []layerSummaryDoc `json:"layers"`
+}
+
+type layerSummaryDoc struct {
+	Name           string            `json:"name"`
+	TileCover      int               `json:"tile_cover"`
+	MinCount       uint64            `json:"min_count"`
+	MaxCount       uint64            `json:"max_count"`
+	AvgCount       float64           `json:"avg_count"`
+	GeomTypes      map[string]uint64 `json:"geom_types"`
+	AvgVertices    float64           `json:"avg_vertices"`
+	MinFeatureSize uint64            `json:"min_feature_size"`
+	MaxFeatureSize uint64            `json:"max_feature_size"`
+	AvgFeatureSize float64           `json:"avg_feature_size"`
+	TopProperties  []propertySummary `json:"top_properties"`
+}
+
+type propertySummary struct {
+	Key            string `json:"key"`
+	Occurrences    uint64 `json:"occurrences"`
+	EstCardinality uint64 `json:"est_cardinality"`
+}
+
+func (s *zoomStats) summaryDoc() zoomSummaryDoc {
+	doc := zoomSummaryDoc{
+		Zoom:        s.zoom,
+		TileCount:   s.tileCount,
+		MinSize:     s.minTileSize,
+		MaxSize:     s.maxTileSize,
+		AvgSize:     float64(s.totalTileSize) / float64(s.tileCount),
+		MinFeatures: s.minFeatures,
+		MaxFeatures: s.maxFeatures,
+		AvgFeatures: float64(s.totalFeatures) / float64(s.tileCount),
+	}
+	var counts layerCounts
+	for layer, count := range s.layer2CountMap {
+		c := *count
+		c.layer = layer
+		counts = append(counts, c)
+	}
+	sort.Sort(counts)
+	for _, count := range counts {
+		ld := layerSummaryDoc{
+			Name:           count.layer,
+			TileCover:      count.tile,
+			MinCount:       count.min,
+			MaxCount:       count.max,
+			AvgCount:       float64(count.total) / float64(count.tile),
+			GeomTypes:      count.geomTypes,
+		}
+		if count.totalFeatures > 0 {
+			ld.AvgVertices = float64(count.totalVertices) / float64(count.totalFeatures)
+			ld.AvgFeatureSize = float64(count.totalFeatSize) / float64(count.totalFeatures)
+			ld.MinFeatureSize = count.minFeatureSize
+			ld.MaxFeatureSize = count.maxFeatureSize
+		}
+
+		keys := make([]string, 0, len(count.propKeyCount))
+		for k := range count.propKeyCount {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return count.propKeyCount[keys[i]] > count.propKeyCount[keys[j]]
+		})
+		if len(keys) > topNProperties {
+			keys = keys[:topNProperties]
+		}
+		for _, k := range keys {
+			ld.TopProperties = append(ld.TopProperties, propertySummary{
+				Key:            k,
+				Occurrences:    count.propKeyCount[k],
+				EstCardinality: count.propKeyHLL[k].estimate(),
+			})
+		}
+
+		doc.Layers = append(doc.Layers, ld)
+	}
+	return doc
+}
+
+type jsonDoc struct {
+	Summary []zoomSummaryDoc `json:"summary"`
+	Tiles   []tileRecord     `json:"tiles"`
+}
+
+type jsonReporter struct {
+	byZoom map[int]*zoomStats
+	tiles  []tileRecord
+}
+
+func (r *jsonReporter) handle(info tileInfo) {
+	s, ok := r.byZoom[info.Z]
+	if !ok {
+		s = newZoomStats(info.Z)
+		r.byZoom[info.Z] = s
+	}
+	s.record(info)
+	r.tiles = append(r.tiles, newTileRecord(info))
+}
+
+func (r *jsonReporter) finish() {
+	var zooms []int
+	for z := range r.byZoom {
+		zooms = append(zooms, z)
+	}
+	sort.Ints(zooms)
+	doc := jsonDoc{}
+	for _, z := range zooms {
+		doc.Summary = append(doc.Summary, r.byZoom[z].summaryDoc())
+	}
+	doc.Tiles = r.tiles
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		fmt.Fprintln(os.Stderr, "go-mvtinfo:", err)
+	}
+}
+
+type ndjsonReporter struct {
+	enc *json.Encoder
+}
+
+func (r *ndjsonReporter) handle(info tileInfo) {
+	r.enc.Encode(newTileRecord(info))
+}
+
+func (r *ndjsonReporter) finish() {}
+
+type csvReporter struct {
+	w *csv.Writer
+}
+
+func (r *csvReporter) handle(info tileInfo) {
+	rec := newTileRecord(info)
+	base := []string{
+		strconv.Itoa(rec.Z), strconv.Itoa(rec.X), strconv.Itoa(rec.Y),
+		strconv.FormatUint(rec.Size, 10), strconv.FormatUint(rec.Gzipped, 10),
+		strconv.FormatUint(rec.Features, 10),
+	}
+	if len(rec.Layers) == 0 {
+		r.w.Write(append(base, "", "", ""))
+		return
+	}
+	for _, l := range rec.Layers {
+		r.w.Write(append(append([]string{}, base...), l.Name, strconv.FormatUint(l.Count, 10), strconv.FormatFloat(l.AvgVertices, 'f', 2, 64)))
+	}
+}
+
+func (r *csvReporter) finish() {
+	r.w.Flush()
+}
+
+// gzippedSize approximates the on-the-wire size of data were it served
+// gzip-compressed, regardless of how the tile source actually delivered it.
+func gzippedSize(data []byte) uint64 {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return uint64(buf.Len())
+}
@@ -0,0 +1,71 @@
+package main
+
+import "github.com/paulmach/orb"
+
+// countVertices walks g and sums the number of coordinate pairs it contains.
+func countVertices(g orb.Geometry) uint64 {
+	switch g := g.(type) {
+	case orb.Point:
+		return 1
+	case orb.MultiPoint:
+		return uint64(len(g))
+	case orb.LineString:
+		return uint64(len(g))
+	case orb.MultiLineString:
+		var n uint64
+		for _, ls := range g {
+			n += uint64(len(ls))
+		}
+		return n
+	case orb.Ring:
+		return uint64(len(g))
+	case orb.Polygon:
+		var n uint64
+		for _, r := range g {
+			n += uint64(len(r))
+		}
+		return n
+	case orb.MultiPolygon:
+		var n uint64
+		for _, p := range g {
+			for _, r := range p {
+				n += uint64(len(r))
+			}
+		}
+		return n
+	case orb.Collection:
+		var n uint64
+		for _, sub := range g {
+			n += countVertices(sub)
+		}
+		return n
+	default:
+		return 0
+	}
+}
+
+// geomTypeName returns the GeoJSON-style type name for g (e.g. "Polygon",
+// "MultiLineString"), used to bucket a layer's geometry-type mix.
+func geomTypeName(g orb.Geometry) string {
+	if g == nil {
+		return "Unknown"
+	}
+	return g.GeoJSONType()
+}
+
+// approxFeatureSize estimates the on-the-wire byte size of a single
+// feature: roughly two bytes per coordinate (zigzag/delta-varint encoded
+// commands in the MVT spec), plus its property keys and values.
+func approxFeatureSize(geom orb.Geometry, properties map[string]interface{}) uint64 {
+	size := countVertices(geom) * 2
+	for k, v := range properties {
+		size += uint64(len(k)) + 1
+		switch v := v.(type) {
+		case string:
+			size += uint64(len(v))
+		default:
+			size += 8
+		}
+	}
+	return size
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// hllPrecision is the number of bits used to select a HyperLogLog register,
+// giving 2^14 = 16384 registers -- enough for a rough cardinality estimate
+// without storing every distinct value.
+const hllPrecision = 14
+
+// hyperLogLog estimates the number of distinct values added to it.
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+func (h *hyperLogLog) add(value string) {
+	f := fnv.New64a()
+	f.Write([]byte(value))
+	hash := f.Sum64()
+
+	idx := hash & (uint64(len(h.registers)) - 1)
+	rest := hash >> hllPrecision
+	rho := uint8(bits.TrailingZeros64(rest)) + 1
+	if rho > h.registers[idx] {
+		h.registers[idx] = rho
+	}
+}
+
+// estimate returns the HyperLogLog cardinality estimate, falling back to
+// linear counting when the raw estimate is at most 2.5 times the register
+// count and at least one register is still empty.
+func (h *hyperLogLog) estimate() uint64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1.0 / math.Pow(2, float64(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	est := alpha * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est)
+}
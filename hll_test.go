@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// TestHyperLogLogEstimate checks the estimator stays within 5% of the true
+// cardinality for distinct inputs, a tolerance several times HyperLogLog's
+// expected standard error of ~1.04/sqrt(2^hllPrecision) (about 0.8%).
+func TestHyperLogLogEstimate(t *testing.T) {
+	const n = 100000
+	h := newHyperLogLog()
+	for i := 0; i < n; i++ {
+		h.add(fmt.Sprintf("value-%d", i))
+	}
+
+	got := h.estimate()
+	diff := math.Abs(float64(got)-float64(n)) / float64(n)
+	if diff > 0.05 {
+		t.Errorf("estimate() = %d, want within 5%% of %d (diff %.2f%%)", got, n, diff*100)
+	}
+}
+
+// TestHyperLogLogEstimateDuplicates checks that re-adding the same values
+// doesn't inflate the estimate.
+func TestHyperLogLogEstimateDuplicates(t *testing.T) {
+	h := newHyperLogLog()
+	for i := 0; i < 10; i++ {
+		h.add("same-value")
+	}
+	if got := h.estimate(); got > 2 {
+		t.Errorf("estimate() of a single repeated value = %d, want <= 2", got)
+	}
+}
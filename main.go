@@ -8,19 +8,15 @@ import (
 	"math"
 	"net/http"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
-	"sync"
-	"text/tabwriter"
+	"time"
 
 	"runtime"
 
 	"compress/gzip"
 
-	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/encoding/mvt"
-	"github.com/paulmach/orb/maptile"
 )
 
 var (
@@ -30,19 +26,47 @@ var (
 	zoom      int
 	offset    int
 	noGzip    bool
+	bboxFlag  string
+	maskFile  string
+	minZoom   int
+	maxZoom   int
+	// minZoomSet/maxZoomSet track whether -min-zoom/-max-zoom were actually
+	// set (by the user or a fetched TileJSON's "minzoom"/"maxzoom"), since 0
+	// is both the flag's default and a valid zoom level.
+	minZoomSet bool
+	maxZoomSet bool
+	format     string
+	tilejson   string
+
+	concurrency int
+	rps         float64
+	retries     int
+	timeout     time.Duration
+	failFast    bool
 )
 
 type layerInfo struct {
-	Name  string
-	Count uint64
+	Name           string
+	Count          uint64
+	GeomTypes      map[string]uint64
+	TotalVertices  uint64
+	MinFeatureSize uint64
+	MaxFeatureSize uint64
+	TotalFeatSize  uint64
+	// PropValues holds, per property key, the raw stringified values seen
+	// on this tile's features in this layer -- merged into a per-layer
+	// HyperLogLog by the aggregator to estimate overall value cardinality.
+	PropValues map[string][]string
 }
 
 type tileInfo struct {
-	X        int
-	Y        int
-	Size     uint64
-	Features uint64
-	Layers   []layerInfo
+	Z           int
+	X           int
+	Y           int
+	Size        uint64
+	GzippedSize uint64
+	Features    uint64
+	Layers      []layerInfo
 }
 
 type layerCount struct {
@@ -55,6 +79,15 @@ type layerCount struct {
 	maxAtY int
 	total  uint64
 	tile   int
+
+	geomTypes      map[string]uint64
+	totalFeatures  uint64
+	totalVertices  uint64
+	minFeatureSize uint64
+	maxFeatureSize uint64
+	totalFeatSize  uint64
+	propKeyCount   map[string]uint64
+	propKeyHLL     map[string]*hyperLogLog
 }
 
 type layerCounts []layerCount
@@ -82,183 +115,199 @@ func main() {
 	flag.IntVar(&zoom, "zoom", 6, "basic zoom")
 	flag.IntVar(&offset, "offset", 2, "zoom offset")
 	flag.BoolVar(&noGzip, "no-gzip", false, "do not use 'Accept-Encoding: gzip'")
+	flag.StringVar(&bboxFlag, "bbox", "", "bounding box minLon,minLat,maxLon,maxLat (overrides -lon/-lat/-offset)")
+	flag.StringVar(&maskFile, "mask", "", "GeoJSON polygon/multipolygon file restricting -bbox to an irregular region")
+	flag.IntVar(&minZoom, "min-zoom", 0, "minimum zoom to scan when -bbox is set (defaults to -zoom)")
+	flag.IntVar(&maxZoom, "max-zoom", 0, "maximum zoom to scan when -bbox is set (defaults to -zoom)")
+	flag.StringVar(&format, "format", "text", "output format: text, json, csv or ndjson")
+	flag.StringVar(&tilejson, "tilejson", "", "TileJSON document URL to seed -url, -min-zoom/-max-zoom and -bbox from")
+	flag.IntVar(&concurrency, "concurrency", 32, "number of tiles to fetch in parallel")
+	flag.Float64Var(&rps, "rps", 0, "max requests per second against the origin (0 = unlimited)")
+	flag.IntVar(&retries, "retries", 2, "retries for a failed tile on 5xx/timeout, with exponential backoff")
+	flag.DurationVar(&timeout, "timeout", 30*time.Second, "per-request HTTP timeout")
+	flag.BoolVar(&failFast, "fail-fast", false, "abort the scan on the first tile failure instead of summarizing at the end")
 	flag.Parse()
 
-	tile := maptile.At(orb.Point{longitude, latitude}, maptile.Zoom(zoom))
-	z := maptile.Zoom(zoom + offset)
-	min, max := tile.Range(z)
-	tileCount := int(max.X-min.X+1) * int(max.Y-min.Y+1)
-
-	ch := make(chan tileInfo)
-	done := make(chan struct{})
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	minZoomSet = explicit["min-zoom"]
+	maxZoomSet = explicit["max-zoom"]
 
-	go func() {
-		var (
-			minTileSize   uint64 = math.MaxUint64
-			maxTileSize   uint64 = 0
-			totalTileSize uint64
-			minFeatures   uint64 = math.MaxUint64
-			maxFeatures   uint64 = 0
-			totalFeatures uint64
-		)
-		var (
-			minTileSizeAtX int
-			minTileSizeAtY int
-			maxTileSizeAtX int
-			maxTileSizeAtY int
-			minFeaturesAtX int
-			minFeaturesAtY int
-			maxFeaturesAtX int
-			maxFeaturesAtY int
-		)
-		layer2CountMap := make(map[string]*layerCount)
-		for info := range ch {
-			if info.Size < minTileSize {
-				minTileSize = info.Size
-				minTileSizeAtX = info.X
-				minTileSizeAtY = info.Y
-			}
-			if info.Size > maxTileSize {
-				maxTileSize = info.Size
-				maxTileSizeAtX = info.X
-				maxTileSizeAtY = info.Y
-			}
-			totalTileSize += info.Size
-			if info.Features < minFeatures {
-				minFeatures = info.Features
-				minFeaturesAtX = info.X
-				minFeaturesAtY = info.Y
-			}
-			if info.Features > maxFeatures {
-				maxFeatures = info.Features
-				maxFeaturesAtX = info.X
-				maxFeaturesAtY = info.Y
-			}
-			totalFeatures += info.Features
-			for _, linfo := range info.Layers {
-				if count, ok := layer2CountMap[linfo.Name]; !ok {
-					layer2CountMap[linfo.Name] = &layerCount{
-						min:    linfo.Count,
-						minAtX: info.X,
-						minAtY: info.Y,
-						max:    linfo.Count,
-						maxAtX: info.X,
-						maxAtY: info.Y,
-						total:  linfo.Count,
-						tile:   1,
-					}
-				} else {
-					if linfo.Count < count.min {
-						count.min = linfo.Count
-						count.minAtX = info.X
-						count.minAtY = info.Y
-					}
-					if linfo.Count > count.max {
-						count.max = linfo.Count
-						count.maxAtX = info.X
-						count.maxAtY = info.Y
-					}
-					count.total += linfo.Count
-					count.tile += 1
-				}
-			}
+	tj, err := resolveTileJSON(url, tilejson)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "go-mvtinfo:", err)
+		os.Exit(1)
+	}
+	if tj != nil {
+		if !explicit["url"] && len(tj.Tiles) > 0 {
+			url = tj.Tiles[0]
+		}
+		if !explicit["min-zoom"] && tj.MinZoom != nil {
+			minZoom = *tj.MinZoom
+			minZoomSet = true
 		}
-		avgTileSize := float64(totalTileSize) / float64(tileCount)
-		avgFeatures := float64(totalFeatures) / float64(tileCount)
-		fmt.Printf("Tile(zoom=%d, count=%d):\n", z, tileCount)
-		w := new(tabwriter.Writer)
-		w.Init(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(w, "  MinSize\tMinSizeAt\tMaxSize\tMaxSizeAt\tAvgSize")
-		fmt.Fprintf(w, "  %d\t(%d,%d)\t%d\t(%d,%d)\t%.2f\n", minTileSize, minTileSizeAtX, minTileSizeAtY, maxTileSize, maxTileSizeAtX, maxTileSizeAtY, avgTileSize)
-		fmt.Fprintln(w, "  MinFeatures\tMinFeaturesAt\tMaxFeatures\tMaxFeaturesAt\tAvgFeatures")
-		fmt.Fprintf(w, "  %d\t(%d,%d)\t%d\t(%d,%d)\t%.2f\n", minFeatures, minFeaturesAtX, minFeaturesAtY, maxFeatures, maxFeaturesAtX, maxFeaturesAtY, avgFeatures)
-		w.Flush()
-		var counts layerCounts
-		for layer, count := range layer2CountMap {
-			c := *count
-			c.layer = layer
-			counts = append(counts, c)
+		if !explicit["max-zoom"] && tj.MaxZoom != nil {
+			maxZoom = *tj.MaxZoom
+			maxZoomSet = true
 		}
-		sort.Sort(counts)
-		fmt.Printf("Layers(count=%d):\n", len(counts))
-		fmt.Fprintln(w, "  Layer\tCover\tMinCount\tMinCountAt\tMaxCount\tMaxCountAt\tAvgCount")
-		for _, count := range counts {
-			avg := float64(count.total) / float64(count.tile)
-			fmt.Fprintf(w, "  %s\t%d\t%d\t(%d,%d)\t%d\t(%d,%d)\t%.2f\n", count.layer, count.tile, count.min, count.minAtX, count.minAtY, count.max, count.maxAtX, count.maxAtY, avg)
+		if !explicit["bbox"] && len(tj.Bounds) == 4 {
+			bboxFlag = fmt.Sprintf("%g,%g,%g,%g", tj.Bounds[0], tj.Bounds[1], tj.Bounds[2], tj.Bounds[3])
 		}
-		w.Flush()
-		done <- struct{}{}
-	}()
+	}
+
+	jobs, err := enumerateJobs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "go-mvtinfo:", err)
+		os.Exit(1)
+	}
 
-	var wg sync.WaitGroup
-	wg.Add(tileCount)
-	for x := min.X; x <= max.X; x++ {
-		for y := min.Y; y <= max.Y; y++ {
-			go func(z, x, y int) {
-				defer wg.Done()
-				getTileInfo(z, x, y, ch)
-			}(int(z), int(x), int(y))
+	src, err := newTileSource(url, noGzip, timeout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "go-mvtinfo:", err)
+		os.Exit(1)
+	}
+
+	rep, err := newReporter(format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "go-mvtinfo:", err)
+		os.Exit(1)
+	}
+
+	failures := runScan(src, jobs, rep, scanOptions{
+		Concurrency: concurrency,
+		RPS:         rps,
+		Retries:     retries,
+		FailFast:    failFast,
+	})
+	if len(failures) > 0 {
+		fmt.Fprintf(os.Stderr, "go-mvtinfo: %d/%d tiles failed:\n", len(failures), len(jobs))
+		for _, f := range failures {
+			fmt.Fprintf(os.Stderr, "  %d/%d/%d: %v\n", f.Job.Z, f.Job.X, f.Job.Y, f.Err)
 		}
+		os.Exit(1)
 	}
-	wg.Wait()
-	close(ch)
+}
 
-	<-done
+// tileSource fetches the raw (decompressed) MVT bytes for a single tile.
+// httpSource hits a `{z}/{x}/{y}` URL template per tile; mbtilesSource reads
+// tiles directly out of a local archive, and pmtilesSource reads them out of
+// a single archive, either a local file or a remote one addressed with HTTP
+// Range requests.
+type tileSource interface {
+	fetchTile(z, x, y int) ([]byte, error)
 }
 
-func getTileInfo(z, x, y int, ch chan tileInfo) {
-	u := url
+func newTileSource(u string, noGzip bool, timeout time.Duration) (tileSource, error) {
+	if isPMTilesURL(u) {
+		return newPMTilesSource(u, timeout)
+	}
+	if isMBTilesURL(u) {
+		return newMBTilesSource(u)
+	}
+	return &httpSource{
+		urlTemplate: u,
+		noGzip:      noGzip,
+		client:      &http.Client{Timeout: timeout},
+	}, nil
+}
+
+type httpSource struct {
+	urlTemplate string
+	noGzip      bool
+	client      *http.Client
+}
+
+func (s *httpSource) fetchTile(z, x, y int) ([]byte, error) {
+	u := s.urlTemplate
 	u = strings.Replace(u, "{z}", strconv.Itoa(z), -1)
 	u = strings.Replace(u, "{x}", strconv.Itoa(x), -1)
 	u = strings.Replace(u, "{y}", strconv.Itoa(y), -1)
 	req, err := http.NewRequest("GET", u, nil)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	if !noGzip {
+	if !s.noGzip {
 		req.Header.Add("Accept-Encoding", "gzip")
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return nil, &retryableError{fmt.Errorf("%s: %s", u, resp.Status)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", u, resp.Status)
+	}
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	size := len(data)
 	ce := resp.Header.Get("Content-Encoding")
-	if strings.Contains(ce, "gzip") && !noGzip {
+	if strings.Contains(ce, "gzip") && !s.noGzip {
 		r, err := gzip.NewReader(bytes.NewReader(data))
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		data, err = ioutil.ReadAll(r)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 	}
+	return data, nil
+}
+
+// parseTileInfo decodes the MVT bytes fetched for (z,x,y) into a tileInfo.
+func parseTileInfo(z, x, y int, data []byte) (tileInfo, error) {
+	size := len(data)
 	layers, err := mvt.Unmarshal(data)
 	if err != nil {
-		panic(err)
+		return tileInfo{}, err
 	}
 	var features uint64
 	var layerInfos []layerInfo
 	for _, layer := range layers {
 		count := len(layer.Features)
 		features += uint64(count)
-		layerInfos = append(layerInfos, layerInfo{
-			Name:  layer.Name,
-			Count: uint64(count),
-		})
+
+		linfo := layerInfo{
+			Name:           layer.Name,
+			Count:          uint64(count),
+			GeomTypes:      make(map[string]uint64),
+			MinFeatureSize: math.MaxUint64,
+			PropValues:     make(map[string][]string),
+		}
+		for _, feature := range layer.Features {
+			linfo.GeomTypes[geomTypeName(feature.Geometry)]++
+			linfo.TotalVertices += countVertices(feature.Geometry)
+
+			fsize := approxFeatureSize(feature.Geometry, feature.Properties)
+			if fsize < linfo.MinFeatureSize {
+				linfo.MinFeatureSize = fsize
+			}
+			if fsize > linfo.MaxFeatureSize {
+				linfo.MaxFeatureSize = fsize
+			}
+			linfo.TotalFeatSize += fsize
+
+			for k, v := range feature.Properties {
+				linfo.PropValues[k] = append(linfo.PropValues[k], fmt.Sprint(v))
+			}
+		}
+		if count == 0 {
+			linfo.MinFeatureSize = 0
+		}
+		layerInfos = append(layerInfos, linfo)
 	}
 	info := tileInfo{
-		X:        x,
-		Y:        y,
-		Size:     uint64(size),
-		Features: features,
-		Layers:   layerInfos,
+		Z:           z,
+		X:           x,
+		Y:           y,
+		Size:        uint64(size),
+		GzippedSize: gzippedSize(data),
+		Features:    features,
+		Layers:      layerInfos,
 	}
-	ch <- info
+	return info, nil
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io/ioutil"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// loadMask reads a GeoJSON file and returns the polygons it contains, either
+// from a bare Geometry, a single Feature, or a FeatureCollection. Only
+// Polygon and MultiPolygon geometries are used to mask tiles; anything else
+// in the file is ignored.
+func loadMask(path string) ([]orb.Polygon, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if fc, err := geojson.UnmarshalFeatureCollection(data); err == nil {
+		var polys []orb.Polygon
+		for _, f := range fc.Features {
+			polys = append(polys, polygonsOf(f.Geometry)...)
+		}
+		return polys, nil
+	}
+	if f, err := geojson.UnmarshalFeature(data); err == nil {
+		return polygonsOf(f.Geometry), nil
+	}
+	g, err := geojson.UnmarshalGeometry(data)
+	if err != nil {
+		return nil, err
+	}
+	return polygonsOf(g.Geometry()), nil
+}
+
+func polygonsOf(g orb.Geometry) []orb.Polygon {
+	switch g := g.(type) {
+	case orb.Polygon:
+		return []orb.Polygon{g}
+	case orb.MultiPolygon:
+		return []orb.Polygon(g)
+	default:
+		return nil
+	}
+}
+
+// maskContains reports whether pt falls inside any of the given polygons,
+// honoring holes (interior rings).
+func maskContains(polys []orb.Polygon, pt orb.Point) bool {
+	for _, poly := range polys {
+		if polygonContains(poly, pt) {
+			return true
+		}
+	}
+	return false
+}
+
+func polygonContains(poly orb.Polygon, pt orb.Point) bool {
+	if len(poly) == 0 || !ringContains(poly[0], pt) {
+		return false
+	}
+	for _, hole := range poly[1:] {
+		if ringContains(hole, pt) {
+			return false
+		}
+	}
+	return true
+}
+
+// ringContains is a standard even-odd ray casting point-in-polygon test.
+func ringContains(ring orb.Ring, pt orb.Point) bool {
+	in := false
+	n := len(ring)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		pi, pj := ring[i], ring[j]
+		if (pi[1] > pt[1]) != (pj[1] > pt[1]) {
+			x := (pj[0]-pi[0])*(pt[1]-pi[1])/(pj[1]-pi[1]) + pi[0]
+			if pt[0] < x {
+				in = !in
+			}
+		}
+	}
+	return in
+}
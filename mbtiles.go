@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// mbtilesSource is a tileSource backed by an MBTiles (SQLite) archive. It
+// reads the standard tiles(zoom_level, tile_column, tile_row, tile_data)
+// table, flipping tile_row from MBTiles' TMS order to the XYZ order the
+// rest of this tool uses.
+type mbtilesSource struct {
+	db          *sql.DB
+	compression string
+}
+
+func isMBTilesURL(u string) bool {
+	lu := strings.ToLower(u)
+	if strings.HasPrefix(lu, "mbtiles://") {
+		return true
+	}
+	lu = strings.SplitN(lu, "?", 2)[0]
+	return strings.HasSuffix(lu, ".mbtiles")
+}
+
+func newMBTilesSource(u string) (*mbtilesSource, error) {
+	path := strings.TrimPrefix(u, "mbtiles://")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	s := &mbtilesSource{db: db}
+	rows, err := db.Query("SELECT name, value FROM metadata")
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var name, value string
+			if err := rows.Scan(&name, &value); err != nil {
+				continue
+			}
+			if name == "compression" {
+				s.compression = value
+			}
+		}
+	}
+	return s, nil
+}
+
+func (s *mbtilesSource) fetchTile(z, x, y int) ([]byte, error) {
+	tmsRow := (1 << uint(z)) - 1 - y
+	var data []byte
+	err := s.db.QueryRow(
+		"SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?",
+		z, x, tmsRow,
+	).Scan(&data)
+	if err != nil {
+		return nil, fmt.Errorf("mbtiles: no tile %d/%d/%d: %v", z, x, y, err)
+	}
+
+	if s.compression == "gzip" || looksGzipped(data) {
+		return gunzip(data)
+	}
+	return data, nil
+}
+
+func looksGzipped(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
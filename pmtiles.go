@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// pmtilesHeaderSize is the fixed size of a PMTiles v3 header, in bytes.
+const pmtilesHeaderSize = 127
+
+var pmtilesMagic = [7]byte{'P', 'M', 'T', 'i', 'l', 'e', 's'}
+
+// pmtilesHeader mirrors the PMTiles v3 header layout.
+type pmtilesHeader struct {
+	SpecVersion          uint8
+	RootDirOffset        uint64
+	RootDirLength        uint64
+	JSONMetadataOffset   uint64
+	JSONMetadataLength   uint64
+	LeafDirectoryOffset  uint64
+	LeafDirectoryLength  uint64
+	TileDataOffset       uint64
+	TileDataLength       uint64
+	NumAddressedTiles    uint64
+	NumTileEntries       uint64
+	NumTileContents      uint64
+	Clustered            uint8
+	InternalCompression  uint8
+	TileCompression      uint8
+	TileType             uint8
+	MinZoom              uint8
+	MaxZoom              uint8
+}
+
+// pmtilesEntry is a single decoded directory entry.
+type pmtilesEntry struct {
+	TileID    uint64
+	Offset    uint64
+	Length    uint32
+	RunLength uint32
+}
+
+// pmtilesReader abstracts reading an arbitrary byte range, so the same
+// directory/tile lookup logic works against a local file or a remote
+// archive addressed with HTTP Range requests.
+type pmtilesReader interface {
+	readRange(offset, length uint64) ([]byte, error)
+}
+
+type pmtilesFileReader struct {
+	f *os.File
+}
+
+func (r *pmtilesFileReader) readRange(offset, length uint64) ([]byte, error) {
+	buf := make([]byte, length)
+	if _, err := r.f.ReadAt(buf, int64(offset)); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+type pmtilesHTTPReader struct {
+	client *http.Client
+	url    string
+}
+
+func (r *pmtilesHTTPReader) readRange(offset, length uint64) ([]byte, error) {
+	req, err := http.NewRequest("GET", r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			return nil, &retryableError{err}
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return nil, &retryableError{fmt.Errorf("pmtiles: range request to %s failed: %s", r.url, resp.Status)}
+	}
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pmtiles: range request to %s failed: %s", r.url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// pmtilesSource is a tileSource backed by a PMTiles v3 archive, read either
+// from a local file or over HTTP with Range requests.
+type pmtilesSource struct {
+	r       pmtilesReader
+	header  pmtilesHeader
+	rootDir []pmtilesEntry
+}
+
+func isPMTilesURL(u string) bool {
+	u = strings.ToLower(u)
+	u = strings.SplitN(u, "?", 2)[0]
+	return strings.HasSuffix(u, ".pmtiles")
+}
+
+func newPMTilesSource(u string, timeout time.Duration) (*pmtilesSource, error) {
+	var r pmtilesReader
+	if strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") {
+		r = &pmtilesHTTPReader{client: &http.Client{Timeout: timeout}, url: u}
+	} else {
+		f, err := os.Open(u)
+		if err != nil {
+			return nil, err
+		}
+		r = &pmtilesFileReader{f: f}
+	}
+
+	raw, err := r.readRange(0, pmtilesHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	header, err := parsePMTilesHeader(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	dirData, err := r.readRange(header.RootDirOffset, header.RootDirLength)
+	if err != nil {
+		return nil, err
+	}
+	dirData, err = decompressPMTiles(dirData, header.InternalCompression)
+	if err != nil {
+		return nil, err
+	}
+	rootDir, err := parsePMTilesDirectory(dirData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pmtilesSource{r: r, header: header, rootDir: rootDir}, nil
+}
+
+func parsePMTilesHeader(raw []byte) (pmtilesHeader, error) {
+	var h pmtilesHeader
+	if len(raw) < pmtilesHeaderSize {
+		return h, fmt.Errorf("pmtiles: header too short: %d bytes", len(raw))
+	}
+	var magic [7]byte
+	copy(magic[:], raw[0:7])
+	if magic != pmtilesMagic {
+		return h, fmt.Errorf("pmtiles: bad magic %q", magic)
+	}
+	h.SpecVersion = raw[7]
+	h.RootDirOffset = binary.LittleEndian.Uint64(raw[8:16])
+	h.RootDirLength = binary.LittleEndian.Uint64(raw[16:24])
+	h.JSONMetadataOffset = binary.LittleEndian.Uint64(raw[24:32])
+	h.JSONMetadataLength = binary.LittleEndian.Uint64(raw[32:40])
+	h.LeafDirectoryOffset = binary.LittleEndian.Uint64(raw[40:48])
+	h.LeafDirectoryLength = binary.LittleEndian.Uint64(raw[48:56])
+	h.TileDataOffset = binary.LittleEndian.Uint64(raw[56:64])
+	h.TileDataLength = binary.LittleEndian.Uint64(raw[64:72])
+	h.NumAddressedTiles = binary.LittleEndian.Uint64(raw[72:80])
+	h.NumTileEntries = binary.LittleEndian.Uint64(raw[80:88])
+	h.NumTileContents = binary.LittleEndian.Uint64(raw[88:96])
+	h.Clustered = raw[96]
+	h.InternalCompression = raw[97]
+	h.TileCompression = raw[98]
+	h.TileType = raw[99]
+	h.MinZoom = raw[100]
+	h.MaxZoom = raw[101]
+	return h, nil
+}
+
+// PMTiles compression identifiers, per the spec.
+const (
+	pmtilesCompressionNone = 1
+	pmtilesCompressionGzip = 2
+)
+
+func decompressPMTiles(data []byte, compression uint8) ([]byte, error) {
+	switch compression {
+	case pmtilesCompressionNone, 0:
+		return data, nil
+	case pmtilesCompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return ioutil.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("pmtiles: unsupported compression %d", compression)
+	}
+}
+
+// parsePMTilesDirectory decodes a directory blob: entry count (varint),
+// then delta/run-length encoded columns for TileID, RunLength, Length and
+// Offset, each varint-encoded.
+func parsePMTilesDirectory(data []byte) ([]pmtilesEntry, error) {
+	buf := bytes.NewReader(data)
+	numEntries, err := binary.ReadUvarint(buf)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]pmtilesEntry, numEntries)
+
+	var lastID uint64
+	for i := uint64(0); i < numEntries; i++ {
+		v, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return nil, err
+		}
+		lastID += v
+		entries[i].TileID = lastID
+	}
+	for i := uint64(0); i < numEntries; i++ {
+		v, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].RunLength = uint32(v)
+	}
+	for i := uint64(0); i < numEntries; i++ {
+		v, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].Length = uint32(v)
+	}
+	for i := uint64(0); i < numEntries; i++ {
+		v, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && v == 0 {
+			entries[i].Offset = entries[i-1].Offset + uint64(entries[i-1].Length)
+		} else {
+			entries[i].Offset = v - 1
+		}
+	}
+	return entries, nil
+}
+
+func findPMTilesEntry(entries []pmtilesEntry, tileID uint64) (pmtilesEntry, bool) {
+	lo, hi := 0, len(entries)-1
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		e := entries[mid]
+		if tileID < e.TileID {
+			hi = mid - 1
+		} else if tileID > e.TileID && (e.RunLength == 0 || tileID >= e.TileID+uint64(e.RunLength)) {
+			lo = mid + 1
+		} else {
+			return e, true
+		}
+	}
+	return pmtilesEntry{}, false
+}
+
+func (s *pmtilesSource) fetchTile(z, x, y int) ([]byte, error) {
+	tileID := zxyToTileID(z, x, y)
+	dir := s.rootDir
+	for depth := 0; depth < 4; depth++ {
+		entry, ok := findPMTilesEntry(dir, tileID)
+		if !ok {
+			return nil, fmt.Errorf("pmtiles: no entry for tile %d/%d/%d", z, x, y)
+		}
+		if entry.RunLength == 0 {
+			// Leaf directory: fetch and descend.
+			raw, err := s.r.readRange(s.header.LeafDirectoryOffset+entry.Offset, uint64(entry.Length))
+			if err != nil {
+				return nil, err
+			}
+			raw, err = decompressPMTiles(raw, s.header.InternalCompression)
+			if err != nil {
+				return nil, err
+			}
+			dir, err = parsePMTilesDirectory(raw)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data, err := s.r.readRange(s.header.TileDataOffset+entry.Offset, uint64(entry.Length))
+		if err != nil {
+			return nil, err
+		}
+		return decompressPMTiles(data, s.header.TileCompression)
+	}
+	return nil, fmt.Errorf("pmtiles: leaf directory recursion too deep for tile %d/%d/%d", z, x, y)
+}
+
+// zxyToTileID converts tile coordinates to the Hilbert-curve TileID used to
+// index a PMTiles directory, per the spec's "base_id(z) + hilbert(z, x, y)".
+func zxyToTileID(z, x, y int) uint64 {
+	var baseID uint64
+	for t := 0; t < z; t++ {
+		baseID += (uint64(1) << uint(t)) * (uint64(1) << uint(t))
+	}
+	return baseID + hilbertXYToD(z, x, y)
+}
+
+// hilbertXYToD maps (x,y) on a 2^z grid to its distance along the Hilbert
+// curve, using the standard bit-rotation algorithm.
+func hilbertXYToD(z, x, y int) uint64 {
+	var rx, ry int
+	var d uint64
+	for s := (1 << uint(z)) / 2; s > 0; s /= 2 {
+		if x&s > 0 {
+			rx = 1
+		} else {
+			rx = 0
+		}
+		if y&s > 0 {
+			ry = 1
+		} else {
+			ry = 0
+		}
+		d += uint64(s) * uint64(s) * uint64((3*rx)^ry)
+		// rotate
+		if ry == 0 {
+			if rx == 1 {
+				x = s - 1 - x
+				y = s - 1 - y
+			}
+			x, y = y, x
+		}
+	}
+	return d
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// TestHilbertXYToD checks hilbertXYToD against the standard order-2 Hilbert
+// curve (n=4), whose traversal order is well known and independent of this
+// package's implementation.
+func TestHilbertXYToD(t *testing.T) {
+	want := map[[2]int]uint64{
+		{0, 0}: 0, {1, 0}: 1, {1, 1}: 2, {0, 1}: 3,
+		{0, 2}: 4, {0, 3}: 5, {1, 3}: 6, {1, 2}: 7,
+		{2, 2}: 8, {2, 3}: 9, {3, 3}: 10, {3, 2}: 11,
+		{3, 1}: 12, {2, 1}: 13, {2, 0}: 14, {3, 0}: 15,
+	}
+	for xy, want := range want {
+		got := hilbertXYToD(2, xy[0], xy[1])
+		if got != want {
+			t.Errorf("hilbertXYToD(2, %d, %d) = %d, want %d", xy[0], xy[1], got, want)
+		}
+	}
+}
+
+// TestZXYToTileID checks that zxyToTileID adds the right per-zoom base_id
+// (the count of tiles at all coarser zooms, (4^z-1)/3) to the Hilbert
+// distance within the zoom.
+func TestZXYToTileID(t *testing.T) {
+	cases := []struct {
+		z, x, y int
+		want    uint64
+	}{
+		{0, 0, 0, 0},
+		{1, 0, 0, 1},
+		{2, 1, 1, 5 + 2},
+		{2, 3, 0, 5 + 15},
+	}
+	for _, c := range cases {
+		got := zxyToTileID(c.z, c.x, c.y)
+		if got != c.want {
+			t.Errorf("zxyToTileID(%d, %d, %d) = %d, want %d", c.z, c.x, c.y, got, c.want)
+		}
+	}
+}
+
+// encodePMTilesDirectory is the inverse of parsePMTilesDirectory, used here
+// only to build fixtures for a round-trip test.
+func encodePMTilesDirectory(entries []pmtilesEntry) []byte {
+	var buf bytes.Buffer
+	var tmp [binary.MaxVarintLen64]byte
+
+	putUvarint := func(v uint64) {
+		n := binary.PutUvarint(tmp[:], v)
+		buf.Write(tmp[:n])
+	}
+
+	putUvarint(uint64(len(entries)))
+
+	var lastID uint64
+	for _, e := range entries {
+		putUvarint(e.TileID - lastID)
+		lastID = e.TileID
+	}
+	for _, e := range entries {
+		putUvarint(uint64(e.RunLength))
+	}
+	for _, e := range entries {
+		putUvarint(uint64(e.Length))
+	}
+	for i, e := range entries {
+		if i > 0 && e.Offset == entries[i-1].Offset+uint64(entries[i-1].Length) {
+			putUvarint(0)
+		} else {
+			putUvarint(e.Offset + 1)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestParsePMTilesDirectoryRoundTrip(t *testing.T) {
+	entries := []pmtilesEntry{
+		{TileID: 0, Offset: 0, Length: 100, RunLength: 1},
+		{TileID: 1, Offset: 100, Length: 200, RunLength: 1}, // contiguous with entry 0
+		{TileID: 7, Offset: 5000, Length: 50, RunLength: 3}, // non-contiguous, a run
+	}
+
+	got, err := parsePMTilesDirectory(encodePMTilesDirectory(entries))
+	if err != nil {
+		t.Fatalf("parsePMTilesDirectory: %v", err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Fatalf("parsePMTilesDirectory round-trip = %+v, want %+v", got, entries)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+)
+
+// tileJob identifies a single tile to scan.
+type tileJob struct {
+	Z, X, Y int
+}
+
+// parseBBox parses "minLon,minLat,maxLon,maxLat" into an orb.Bound.
+func parseBBox(s string) (orb.Bound, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return orb.Bound{}, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat, got %q", s)
+	}
+	var f [4]float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return orb.Bound{}, fmt.Errorf("bbox: invalid number %q: %v", p, err)
+		}
+		f[i] = v
+	}
+	return orb.Bound{Min: orb.Point{f[0], f[1]}, Max: orb.Point{f[2], f[3]}}, nil
+}
+
+// tilesInBound returns the top-left and bottom-right tiles at zoom z that
+// contain bound's corners; every tile between them in column and row covers
+// part of bound.
+func tilesInBound(bound orb.Bound, z maptile.Zoom) (min, max maptile.Tile) {
+	topLeft := maptile.At(orb.Point{bound.Min[0], bound.Max[1]}, z)
+	bottomRight := maptile.At(orb.Point{bound.Max[0], bound.Min[1]}, z)
+	return topLeft, bottomRight
+}
+
+// enumerateJobs builds the list of tiles to scan based on the parsed flags:
+// -bbox (optionally restricted by -mask) across -min-zoom.. -max-zoom, or
+// the legacy single point + -offset scan over one zoom level.
+func enumerateJobs() ([]tileJob, error) {
+	if bboxFlag == "" {
+		tile := maptile.At(orb.Point{longitude, latitude}, maptile.Zoom(zoom))
+		z := zoom + offset
+		min, max := tile.Range(maptile.Zoom(z))
+		var jobs []tileJob
+		for x := min.X; x <= max.X; x++ {
+			for y := min.Y; y <= max.Y; y++ {
+				jobs = append(jobs, tileJob{Z: z, X: int(x), Y: int(y)})
+			}
+		}
+		return jobs, nil
+	}
+
+	bound, err := parseBBox(bboxFlag)
+	if err != nil {
+		return nil, err
+	}
+	var mask []orb.Polygon
+	if maskFile != "" {
+		mask, err = loadMask(maskFile)
+		if err != nil {
+			return nil, fmt.Errorf("mask: %v", err)
+		}
+	}
+	lo, hi := minZoom, maxZoom
+	if !minZoomSet {
+		lo = zoom
+	}
+	if !maxZoomSet {
+		hi = zoom
+	}
+	if lo > hi {
+		return nil, fmt.Errorf("min-zoom %d is greater than max-zoom %d", lo, hi)
+	}
+	return enumerateRegion(bound, lo, hi, mask), nil
+}
+
+// enumerateRegion lists the tile jobs to scan across minZoom..maxZoom for
+// bound, dropping (when mask is non-empty) every candidate tile whose center
+// falls outside mask; a tile the mask only partly covers is dropped too when
+// its center lies outside.
+func enumerateRegion(bound orb.Bound, minZoom, maxZoom int, mask []orb.Polygon) []tileJob {
+	var jobs []tileJob
+	for z := minZoom; z <= maxZoom; z++ {
+		min, max := tilesInBound(bound, maptile.Zoom(z))
+		for x := min.X; x <= max.X; x++ {
+			for y := min.Y; y <= max.Y; y++ {
+				if len(mask) > 0 {
+					center := maptile.Tile{X: x, Y: y, Z: maptile.Zoom(z)}.Bound().Center()
+					if !maskContains(mask, center) {
+						continue
+					}
+				}
+				jobs = append(jobs, tileJob{Z: z, X: int(x), Y: int(y)})
+			}
+		}
+	}
+	return jobs
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// retryableError marks a fetch failure (a 5xx response, or a timed-out
+// PMTiles range request) as safe to retry, as opposed to a permanent error
+// like a 404 or a bad URL.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// isRetryable reports whether err is worth retrying: a *retryableError, or
+// a network-level timeout.
+func isRetryable(err error) bool {
+	var re *retryableError
+	if errors.As(err, &re) {
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return ne.Timeout()
+	}
+	return false
+}
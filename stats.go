@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// zoomStats accumulates the tile-size/feature-count/layer-count aggregates
+// for a single zoom level, across however many tiles were scanned at it.
+type zoomStats struct {
+	zoom int
+
+	tileCount     int
+	minTileSize   uint64
+	maxTileSize   uint64
+	totalTileSize uint64
+	minFeatures   uint64
+	maxFeatures   uint64
+	totalFeatures uint64
+
+	minTileSizeAtX, minTileSizeAtY int
+	maxTileSizeAtX, maxTileSizeAtY int
+	minFeaturesAtX, minFeaturesAtY int
+	maxFeaturesAtX, maxFeaturesAtY int
+
+	layer2CountMap map[string]*layerCount
+}
+
+func newZoomStats(zoom int) *zoomStats {
+	return &zoomStats{
+		zoom:           zoom,
+		minTileSize:    math.MaxUint64,
+		minFeatures:    math.MaxUint64,
+		layer2CountMap: make(map[string]*layerCount),
+	}
+}
+
+func (s *zoomStats) record(info tileInfo) {
+	s.tileCount++
+	if info.Size < s.minTileSize {
+		s.minTileSize = info.Size
+		s.minTileSizeAtX = info.X
+		s.minTileSizeAtY = info.Y
+	}
+	if info.Size > s.maxTileSize {
+		s.maxTileSize = info.Size
+		s.maxTileSizeAtX = info.X
+		s.maxTileSizeAtY = info.Y
+	}
+	s.totalTileSize += info.Size
+	if info.Features < s.minFeatures {
+		s.minFeatures = info.Features
+		s.minFeaturesAtX = info.X
+		s.minFeaturesAtY = info.Y
+	}
+	if info.Features > s.maxFeatures {
+		s.maxFeatures = info.Features
+		s.maxFeaturesAtX = info.X
+		s.maxFeaturesAtY = info.Y
+	}
+	s.totalFeatures += info.Features
+	for _, linfo := range info.Layers {
+		count, ok := s.layer2CountMap[linfo.Name]
+		if !ok {
+			count = &layerCount{
+				min:            linfo.Count,
+				minAtX:         info.X,
+				minAtY:         info.Y,
+				max:            linfo.Count,
+				maxAtX:         info.X,
+				maxAtY:         info.Y,
+				total:          linfo.Count,
+				tile:           1,
+				geomTypes:      make(map[string]uint64),
+				minFeatureSize: math.MaxUint64,
+				propKeyCount:   make(map[string]uint64),
+				propKeyHLL:     make(map[string]*hyperLogLog),
+			}
+			s.layer2CountMap[linfo.Name] = count
+		} else {
+			if linfo.Count < count.min {
+				count.min = linfo.Count
+				count.minAtX = info.X
+				count.minAtY = info.Y
+			}
+			if linfo.Count > count.max {
+				count.max = linfo.Count
+				count.maxAtX = info.X
+				count.maxAtY = info.Y
+			}
+			count.total += linfo.Count
+			count.tile += 1
+		}
+
+		count.totalFeatures += linfo.Count
+		count.totalVertices += linfo.TotalVertices
+		count.totalFeatSize += linfo.TotalFeatSize
+		if linfo.Count > 0 {
+			if linfo.MinFeatureSize < count.minFeatureSize {
+				count.minFeatureSize = linfo.MinFeatureSize
+			}
+			if linfo.MaxFeatureSize > count.maxFeatureSize {
+				count.maxFeatureSize = linfo.MaxFeatureSize
+			}
+		}
+		for geomType, n := range linfo.GeomTypes {
+			count.geomTypes[geomType] += n
+		}
+		for key, values := range linfo.PropValues {
+			count.propKeyCount[key] += uint64(len(values))
+			hll, ok := count.propKeyHLL[key]
+			if !ok {
+				hll = newHyperLogLog()
+				count.propKeyHLL[key] = hll
+			}
+			for _, v := range values {
+				hll.add(v)
+			}
+		}
+	}
+}
+
+func (s *zoomStats) print(w *tabwriter.Writer) {
+	avgTileSize := float64(s.totalTileSize) / float64(s.tileCount)
+	avgFeatures := float64(s.totalFeatures) / float64(s.tileCount)
+	fmt.Printf("Tile(zoom=%d, count=%d):\n", s.zoom, s.tileCount)
+	fmt.Fprintln(w, "  MinSize\tMinSizeAt\tMaxSize\tMaxSizeAt\tAvgSize")
+	fmt.Fprintf(w, "  %d\t(%d,%d)\t%d\t(%d,%d)\t%.2f\n", s.minTileSize, s.minTileSizeAtX, s.minTileSizeAtY, s.maxTileSize, s.maxTileSizeAtX, s.maxTileSizeAtY, avgTileSize)
+	fmt.Fprintln(w, "  MinFeatures\tMinFeaturesAt\tMaxFeatures\tMaxFeaturesAt\tAvgFeatures")
+	fmt.Fprintf(w, "  %d\t(%d,%d)\t%d\t(%d,%d)\t%.2f\n", s.minFeatures, s.minFeaturesAtX, s.minFeaturesAtY, s.maxFeatures, s.maxFeaturesAtX, s.maxFeaturesAtY, avgFeatures)
+	w.Flush()
+
+	var counts layerCounts
+	for layer, count := range s.layer2CountMap {
+		c := *count
+		c.layer = layer
+		counts = append(counts, c)
+	}
+	sort.Sort(counts)
+	fmt.Printf("Layers(count=%d):\n", len(counts))
+	fmt.Fprintln(w, "  Layer\tCover\tMinCount\tMinCountAt\tMaxCount\tMaxCountAt\tAvgCount")
+	for _, count := range counts {
+		avg := float64(count.total) / float64(count.tile)
+		fmt.Fprintf(w, "  %s\t%d\t%d\t(%d,%d)\t%d\t(%d,%d)\t%.2f\n", count.layer, count.tile, count.min, count.minAtX, count.minAtY, count.max, count.maxAtX, count.maxAtY, avg)
+	}
+	w.Flush()
+
+	for _, count := range counts {
+		count.print(w)
+	}
+}
+
+// topNProperties bounds how many property keys get a cardinality estimate
+// printed per layer, ranked by how often they occur.
+const topNProperties = 5
+
+// print renders the geometry-type mix, vertex/size stats and top property
+// keys accumulated for one layer.
+func (c layerCount) print(w *tabwriter.Writer) {
+	fmt.Printf("  %s:\n", c.layer)
+
+	var geomTypes []string
+	for t := range c.geomTypes {
+		geomTypes = append(geomTypes, t)
+	}
+	sort.Strings(geomTypes)
+	fmt.Fprintln(w, "    GeomType\tCount")
+	for _, t := range geomTypes {
+		fmt.Fprintf(w, "    %s\t%d\n", t, c.geomTypes[t])
+	}
+	w.Flush()
+
+	var avgVertices, avgFeatSize float64
+	minFeatureSize, maxFeatureSize := c.minFeatureSize, c.maxFeatureSize
+	if c.totalFeatures > 0 {
+		avgVertices = float64(c.totalVertices) / float64(c.totalFeatures)
+		avgFeatSize = float64(c.totalFeatSize) / float64(c.totalFeatures)
+	} else {
+		minFeatureSize, maxFeatureSize = 0, 0
+	}
+	fmt.Fprintln(w, "    AvgVertices\tMinFeatSize\tMaxFeatSize\tAvgFeatSize")
+	fmt.Fprintf(w, "    %.2f\t%d\t%d\t%.2f\n", avgVertices, minFeatureSize, maxFeatureSize, avgFeatSize)
+	w.Flush()
+
+	keys := make([]string, 0, len(c.propKeyCount))
+	for k := range c.propKeyCount {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.propKeyCount[keys[i]] > c.propKeyCount[keys[j]]
+	})
+	if len(keys) > topNProperties {
+		keys = keys[:topNProperties]
+	}
+	fmt.Fprintln(w, "    Property\tOccurrences\tEstCardinality")
+	for _, k := range keys {
+		fmt.Fprintf(w, "    %s\t%d\t%d\n", k, c.propKeyCount[k], c.propKeyHLL[k].estimate())
+	}
+	w.Flush()
+}
+
+// printReport renders one zoomStats section per zoom level scanned, in
+// ascending zoom order.
+func printReport(byZoom map[int]*zoomStats) {
+	var zooms []int
+	for z := range byZoom {
+		zooms = append(zooms, z)
+	}
+	sort.Ints(zooms)
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, z := range zooms {
+		byZoom[z].print(w)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// tileJSONDoc holds the fields of a TileJSON document this tool cares
+// about: the tile URL template, the zoom range, and the coverage bounds.
+type tileJSONDoc struct {
+	Tiles   []string  `json:"tiles"`
+	MinZoom *int      `json:"minzoom"`
+	MaxZoom *int      `json:"maxzoom"`
+	Bounds  []float64 `json:"bounds"`
+}
+
+func looksLikeTileJSONURL(u string) bool {
+	lu := strings.ToLower(strings.SplitN(u, "?", 2)[0])
+	return strings.HasSuffix(lu, ".json")
+}
+
+func fetchTileJSON(u string) (*tileJSONDoc, error) {
+	resp, err := http.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tilejson: %s: %s", u, resp.Status)
+	}
+	var doc tileJSONDoc
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("tilejson: %s: %v", u, err)
+	}
+	if len(doc.Tiles) == 0 {
+		return nil, fmt.Errorf("tilejson: %s: no \"tiles\" entries", u)
+	}
+	return &doc, nil
+}
+
+// resolveTileJSON decides whether to treat tilejsonURL or urlFlag as a
+// TileJSON document and, if so, fetches and decodes it. An explicit
+// -tilejson flag always wins; otherwise urlFlag is auto-detected by its
+// ".json" suffix or, failing that, by sniffing the response's
+// Content-Type once fetched. It returns (nil, nil) when neither applies.
+func resolveTileJSON(urlFlag, tilejsonURL string) (*tileJSONDoc, error) {
+	if tilejsonURL != "" {
+		return fetchTileJSON(tilejsonURL)
+	}
+	if urlFlag == "" || isPMTilesURL(urlFlag) || isMBTilesURL(urlFlag) || strings.Contains(urlFlag, "{z}") {
+		return nil, nil
+	}
+	if looksLikeTileJSONURL(urlFlag) {
+		return fetchTileJSON(urlFlag)
+	}
+
+	resp, err := http.Get(urlFlag)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return nil, nil
+	}
+	var doc tileJSONDoc
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("tilejson: %s: %v", urlFlag, err)
+	}
+	if len(doc.Tiles) == 0 {
+		return nil, fmt.Errorf("tilejson: %s: no \"tiles\" entries", urlFlag)
+	}
+	return &doc, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// scanOptions configures how runScan drives the worker pool.
+type scanOptions struct {
+	Concurrency int
+	RPS         float64
+	Retries     int
+	FailFast    bool
+}
+
+// tileFailure records a tile that could not be fetched/parsed: after
+// exhausting retries for a retryable error, or on the first attempt for any
+// other error.
+type tileFailure struct {
+	Job tileJob
+	Err error
+}
+
+// runScan fetches every job in jobs through a bounded worker pool, handing
+// successes to rep as they complete and collecting failures instead of
+// panicking. With opts.FailFast set, the first failure stops the scan.
+func runScan(src tileSource, jobs []tileJob, rep reporter, opts scanOptions) []tileFailure {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var limiter *rate.Limiter
+	if opts.RPS > 0 {
+		burst := int(opts.RPS)
+		if burst < 1 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(rate.Limit(opts.RPS), burst)
+	}
+
+	jobCh := make(chan tileJob)
+	infoCh := make(chan tileInfo)
+	failCh := make(chan tileFailure)
+	abort := make(chan struct{})
+	var abortOnce sync.Once
+
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobCh {
+				info, err := fetchTileWithRetry(src, job, opts.Retries, limiter)
+				if err != nil {
+					failCh <- tileFailure{Job: job, Err: err}
+					if opts.FailFast {
+						abortOnce.Do(func() { close(abort) })
+					}
+					continue
+				}
+				infoCh <- info
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobCh)
+		for _, job := range jobs {
+			select {
+			case jobCh <- job:
+			case <-abort:
+				return
+			}
+		}
+	}()
+
+	var failures []tileFailure
+	failuresDone := make(chan struct{})
+	go func() {
+		for f := range failCh {
+			failures = append(failures, f)
+		}
+		close(failuresDone)
+	}()
+
+	reportDone := make(chan struct{})
+	go func() {
+		for info := range infoCh {
+			rep.handle(info)
+		}
+		rep.finish()
+		close(reportDone)
+	}()
+
+	workers.Wait()
+	close(infoCh)
+	close(failCh)
+	<-reportDone
+	<-failuresDone
+
+	return failures
+}
+
+// fetchTileWithRetry fetches and parses one tile, retrying up to retries
+// times with exponential backoff when the fetch fails with a retryable
+// error (a 5xx response or a network timeout). Every attempt, including the
+// first, waits on limiter (when set) so retries against a struggling origin
+// stay under -rps too.
+func fetchTileWithRetry(src tileSource, job tileJob, retries int, limiter *rate.Limiter) (tileInfo, error) {
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff(attempt))
+		}
+		if limiter != nil {
+			limiter.Wait(context.Background())
+		}
+		data, err := src.fetchTile(job.Z, job.X, job.Y)
+		if err != nil {
+			lastErr = err
+			if !isRetryable(err) {
+				return tileInfo{}, err
+			}
+			continue
+		}
+		return parseTileInfo(job.Z, job.X, job.Y, data)
+	}
+	return tileInfo{}, lastErr
+}
+
+func backoff(attempt int) time.Duration {
+	d := 100 * time.Millisecond
+	for i := 1; i < attempt; i++ {
+		d *= 2
+	}
+	if d > 5*time.Second {
+		d = 5 * time.Second
+	}
+	return d
+}